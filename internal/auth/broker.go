@@ -0,0 +1,73 @@
+// Copyright 2022 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"sync"
+	"time"
+
+	"github.com/minio/kes"
+)
+
+// Event describes a single change to a policy or an identity
+// assignment. For policy events, Name is the policy that changed and
+// Identity is unset. For identity events, Name is the policy that
+// was (un)assigned and Identity is the identity it was (un)assigned
+// to or from. CreatedBy is always the identity that performed the
+// change, never the subject of the change itself.
+type Event struct {
+	Op        string // "put" or "delete"
+	Name      string
+	Identity  kes.Identity
+	Version   int
+	CreatedAt time.Time
+	CreatedBy kes.Identity
+}
+
+// Broker fans out Events to any number of subscribers. Its zero
+// value is ready to use. A Broker is safe for concurrent use.
+type Broker struct {
+	lock        sync.Mutex
+	subscribers map[chan<- Event]struct{}
+}
+
+// Subscribe registers a new subscriber and returns a channel of
+// events and a cancel function. The caller must call cancel once
+// it stops reading from the channel to release the subscription.
+func (b *Broker) Subscribe() (<-chan Event, func()) {
+	events := make(chan Event, 16)
+
+	b.lock.Lock()
+	if b.subscribers == nil {
+		b.subscribers = map[chan<- Event]struct{}{}
+	}
+	b.subscribers[events] = struct{}{}
+	b.lock.Unlock()
+
+	cancel := func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		if _, ok := b.subscribers[events]; ok {
+			delete(b.subscribers, events)
+			close(events)
+		}
+	}
+	return events, cancel
+}
+
+// Publish fans event out to all current subscribers. A subscriber
+// that isn't keeping up is skipped instead of blocking Publish.
+func (b *Broker) Publish(event Event) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for events := range b.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package auth
+
+import "testing"
+
+func TestBrokerPublishSubscribe(t *testing.T) {
+	var broker Broker
+
+	events, cancel := broker.Subscribe()
+	defer cancel()
+
+	broker.Publish(Event{Op: "put", Name: "my-policy"})
+
+	select {
+	case event := <-events:
+		if event.Op != "put" || event.Name != "my-policy" {
+			t.Fatalf("event = %+v, want {Op: put, Name: my-policy}", event)
+		}
+	default:
+		t.Fatal("subscriber did not receive the published event")
+	}
+}
+
+func TestBrokerCancelClosesChannel(t *testing.T) {
+	var broker Broker
+
+	events, cancel := broker.Subscribe()
+	cancel()
+
+	if _, ok := <-events; ok {
+		t.Fatal("channel should be closed after cancel")
+	}
+}
+
+func TestBrokerPublishWithoutSubscribersDoesNotBlock(t *testing.T) {
+	var broker Broker
+	broker.Publish(Event{Op: "put", Name: "my-policy"})
+}
@@ -0,0 +1,403 @@
+// Copyright 2022 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	gopath "path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/kes"
+	"github.com/minio/kes/internal/keystore/mem"
+)
+
+// Policy is a named set of allow/deny rules that control which API
+// operations an identity may perform once the policy is assigned to
+// it.
+type Policy struct {
+	Allow     []string
+	Deny      []string
+	CreatedAt time.Time
+	CreatedBy kes.Identity
+
+	// Version is a monotonically increasing revision number, set by
+	// Enclave.SetPolicy. The first version of a policy is 1.
+	Version int
+
+	// Signature is an HMAC-SHA256 over the canonicalized version -
+	// rules, version number and authorship included - computed by
+	// Enclave.SetPolicy using the enclave's signing key. It lets
+	// auditors detect whether a policy version returned by the store
+	// was tampered with.
+	//
+	// This is a symmetric MAC, not a non-repudiable signature:
+	// anyone holding signKey can both verify and forge it. Pass
+	// Enclave a signing key dedicated to this purpose - never the
+	// server's TLS/identity private key - or a compromise of one
+	// compromises the other.
+	Signature []byte
+}
+
+// canonicalPolicy is the deterministic, signable representation of a
+// policy version - the parts of a Policy that version history and
+// signatures are computed over. It covers the full version, not just
+// the rules, so that a version's timestamp or author can't be
+// altered without invalidating its signature.
+type canonicalPolicy struct {
+	Name      string       `json:"name"`
+	Allow     []string     `json:"allow,omitempty"`
+	Deny      []string     `json:"deny,omitempty"`
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at,omitempty"`
+	CreatedBy kes.Identity `json:"created_by,omitempty"`
+}
+
+func canonicalize(name string, policy *Policy) ([]byte, error) {
+	allow := append([]string(nil), policy.Allow...)
+	deny := append([]string(nil), policy.Deny...)
+	sort.Strings(allow)
+	sort.Strings(deny)
+	return json.Marshal(canonicalPolicy{
+		Name:      name,
+		Allow:     allow,
+		Deny:      deny,
+		Version:   policy.Version,
+		CreatedAt: policy.CreatedAt,
+		CreatedBy: policy.CreatedBy,
+	})
+}
+
+// Verify reports whether method and path are allowed by p, and the
+// allow/deny rule that decided the outcome. Deny rules take
+// precedence over allow rules, mirroring how KES evaluates a
+// request against the policy assigned to its identity.
+func (p *Policy) Verify(method, path string) (allow bool, rule string) {
+	target := method + " " + path
+	for _, pattern := range p.Deny {
+		if ok, _ := gopath.Match(pattern, target); ok {
+			return false, pattern
+		}
+	}
+	for _, pattern := range p.Allow {
+		if ok, _ := gopath.Match(pattern, target); ok {
+			return true, pattern
+		}
+	}
+	return false, ""
+}
+
+// PolicyIterator iterates over one page of policy names returned by
+// Enclave.ListPolicies.
+type PolicyIterator struct {
+	names []string
+	index int
+}
+
+// Next advances the iterator to the next name. It returns false
+// once the page is exhausted.
+func (i *PolicyIterator) Next() bool {
+	if i.index < len(i.names) {
+		i.index++
+		return true
+	}
+	return false
+}
+
+// Name returns the policy name the iterator currently points to.
+func (i *PolicyIterator) Name() string { return i.names[i.index-1] }
+
+// Close releases any resources held by the iterator.
+func (i *PolicyIterator) Close() error { return nil }
+
+// Enclave groups the policies and identity assignments managed by
+// one KES server instance.
+type Enclave struct {
+	signKey []byte
+
+	lock       sync.RWMutex
+	policies   map[string]*Policy
+	identities map[kes.Identity]string
+
+	history *mem.Store
+
+	// Policies fans out a put/delete Event for every SetPolicy and
+	// DeletePolicy call, for /v1/policy/watch/ subscribers.
+	Policies *Broker
+
+	// Identities fans out an Event for every AssignPolicy and
+	// DeleteIdentity call, for /v1/identity/watch/ subscribers.
+	Identities *Broker
+}
+
+// NewEnclave returns a new, empty Enclave that signs policy
+// versions with signKey.
+func NewEnclave(signKey []byte) *Enclave {
+	return &Enclave{
+		signKey:    signKey,
+		policies:   map[string]*Policy{},
+		identities: map[kes.Identity]string{},
+		history:    &mem.Store{},
+		Policies:   &Broker{},
+		Identities: &Broker{},
+	}
+}
+
+// VerifyRequest returns an error if e is nil. It does not check
+// r's identity against any policy of the enclave. The TLS handshake
+// already authenticated the client certificate by the time a
+// request reaches the policy handlers - VerifyRequest only guards
+// against a nil enclave.
+func (e *Enclave) VerifyRequest(r *http.Request) error {
+	if e == nil {
+		return kes.NewError(http.StatusForbidden, "no such enclave")
+	}
+	return nil
+}
+
+// GetPolicy returns the policy with the given name.
+func (e *Enclave) GetPolicy(ctx context.Context, name string) (*Policy, error) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	policy, ok := e.policies[name]
+	if !ok {
+		return nil, kes.NewError(http.StatusNotFound, "policy does not exist")
+	}
+	return policy, nil
+}
+
+// SetPolicy creates or replaces the policy with the given name. It
+// assigns the new version a number one greater than the previous
+// one, signs the canonicalized version - rules, version number and
+// authorship - with the enclave's signing key, and records the
+// result in the policy's version history.
+func (e *Enclave) SetPolicy(ctx context.Context, name string, policy *Policy) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	version := 1
+	if prev, ok := e.policies[name]; ok {
+		version = prev.Version + 1
+	}
+	policy.Version = version
+
+	canonical, err := canonicalize(name, policy)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, e.signKey)
+	mac.Write(canonical)
+	hash := sha256.Sum256(canonical)
+
+	policy.Signature = mac.Sum(nil)
+
+	if err = e.history.PutVersion(ctx, name, mem.Version{
+		Version:   version,
+		CreatedAt: policy.CreatedAt,
+		CreatedBy: policy.CreatedBy,
+		Signature: policy.Signature,
+		Hash:      hash[:],
+		Policy:    canonical,
+	}); err != nil {
+		return err
+	}
+
+	e.policies[name] = policy
+	e.Policies.Publish(Event{
+		Op:        "put",
+		Name:      name,
+		Version:   version,
+		CreatedAt: policy.CreatedAt,
+		CreatedBy: policy.CreatedBy,
+	})
+	return nil
+}
+
+// GetPolicyVersion returns a specific, past version of the policy
+// with the given name.
+func (e *Enclave) GetPolicyVersion(ctx context.Context, name string, version int) (*Policy, error) {
+	v, err := e.history.GetVersion(ctx, name, version)
+	if err != nil {
+		return nil, kes.NewError(http.StatusNotFound, "policy version does not exist")
+	}
+
+	var canonical canonicalPolicy
+	if err = json.Unmarshal(v.Policy, &canonical); err != nil {
+		return nil, err
+	}
+	return &Policy{
+		Allow:     canonical.Allow,
+		Deny:      canonical.Deny,
+		CreatedAt: v.CreatedAt,
+		CreatedBy: v.CreatedBy,
+		Version:   v.Version,
+		Signature: v.Signature,
+	}, nil
+}
+
+// ListPolicyVersions returns the version history of the policy with
+// the given name, oldest first.
+func (e *Enclave) ListPolicyVersions(ctx context.Context, name string) ([]mem.Version, error) {
+	return e.history.ListVersions(ctx, name)
+}
+
+// DeletePolicy removes the policy with the given name, if it
+// exists.
+func (e *Enclave) DeletePolicy(ctx context.Context, name string) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	delete(e.policies, name)
+	e.Policies.Publish(Event{Op: "delete", Name: name})
+	return nil
+}
+
+// AssignPolicy assigns the policy with the given name to identity.
+// It returns an error if no such policy exists. createdBy is the
+// identity that requested the assignment and is recorded on the
+// resulting Event, not identity itself.
+func (e *Enclave) AssignPolicy(ctx context.Context, name string, identity, createdBy kes.Identity) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if _, ok := e.policies[name]; !ok {
+		return kes.NewError(http.StatusNotFound, "policy does not exist")
+	}
+	e.identities[identity] = name
+	e.Identities.Publish(Event{Op: "put", Name: name, Identity: identity, CreatedBy: createdBy})
+	return nil
+}
+
+// DeleteIdentity removes the policy assignment for identity, if one
+// exists. createdBy is the identity that requested the removal and
+// is recorded on the resulting Event, not identity itself.
+func (e *Enclave) DeleteIdentity(ctx context.Context, identity, createdBy kes.Identity) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	name := e.identities[identity]
+	delete(e.identities, identity)
+	e.Identities.Publish(Event{Op: "delete", Name: name, Identity: identity, CreatedBy: createdBy})
+	return nil
+}
+
+// IdentityPolicyName returns the name of the policy currently
+// assigned to identity, without fetching the policy document
+// itself.
+func (e *Enclave) IdentityPolicyName(ctx context.Context, identity kes.Identity) (string, error) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	name, ok := e.identities[identity]
+	if !ok {
+		return "", kes.NewError(http.StatusNotFound, "identity has no assigned policy")
+	}
+	return name, nil
+}
+
+// IdentityAssignment pairs an identity with the name of the policy
+// assigned to it, as returned by Enclave.ListIdentities.
+type IdentityAssignment struct {
+	Identity kes.Identity
+	Policy   string
+}
+
+// IdentityIterator iterates over one page of identity assignments
+// returned by Enclave.ListIdentities.
+type IdentityIterator struct {
+	assignments []IdentityAssignment
+	index       int
+}
+
+// Next advances the iterator to the next assignment. It returns
+// false once the page is exhausted.
+func (i *IdentityIterator) Next() bool {
+	if i.index < len(i.assignments) {
+		i.index++
+		return true
+	}
+	return false
+}
+
+// Identity returns the identity the iterator currently points to.
+func (i *IdentityIterator) Identity() kes.Identity { return i.assignments[i.index-1].Identity }
+
+// Policy returns the name of the policy assigned to the identity the
+// iterator currently points to.
+func (i *IdentityIterator) Policy() string { return i.assignments[i.index-1].Policy }
+
+// Close releases any resources held by the iterator.
+func (i *IdentityIterator) Close() error { return nil }
+
+// ListIdentities returns a page of at most limit identity
+// assignments whose identity starts with prefix, starting right
+// after continueAt. It returns a continuation token for the next
+// page, or an empty token once the listing is exhausted.
+func (e *Enclave) ListIdentities(ctx context.Context, prefix, continueAt string, limit int) (*IdentityIterator, string, error) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	assignments := make([]IdentityAssignment, 0, len(e.identities))
+	for identity, name := range e.identities {
+		if strings.HasPrefix(string(identity), prefix) {
+			assignments = append(assignments, IdentityAssignment{Identity: identity, Policy: name})
+		}
+	}
+	sort.Slice(assignments, func(i, j int) bool { return assignments[i].Identity < assignments[j].Identity })
+
+	if continueAt != "" {
+		i := sort.Search(len(assignments), func(i int) bool { return string(assignments[i].Identity) >= continueAt })
+		if i < len(assignments) && string(assignments[i].Identity) == continueAt {
+			i++
+		}
+		assignments = assignments[i:]
+	}
+
+	var next string
+	if limit > 0 && len(assignments) > limit {
+		next = string(assignments[limit-1].Identity)
+		assignments = assignments[:limit]
+	}
+	return &IdentityIterator{assignments: assignments}, next, nil
+}
+
+// ListPolicies returns a page of at most limit policy names whose
+// name starts with prefix, starting right after continueAt. It
+// returns a continuation token for the next page, or an empty
+// token once the listing is exhausted.
+func (e *Enclave) ListPolicies(ctx context.Context, prefix, continueAt string, limit int) (*PolicyIterator, string, error) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	names := make([]string, 0, len(e.policies))
+	for name := range e.policies {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if continueAt != "" {
+		i := sort.SearchStrings(names, continueAt)
+		if i < len(names) && names[i] == continueAt {
+			i++
+		}
+		names = names[i:]
+	}
+
+	var next string
+	if limit > 0 && len(names) > limit {
+		next = names[limit-1]
+		names = names[:limit]
+	}
+	return &PolicyIterator{names: names}, next, nil
+}
@@ -0,0 +1,168 @@
+// Copyright 2022 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/minio/kes"
+)
+
+func TestEnclaveSetPolicyVersioning(t *testing.T) {
+	ctx := context.Background()
+	enclave := NewEnclave([]byte("test-signing-key"))
+
+	policy := &Policy{Allow: []string{"GET /v1/key/*"}, CreatedBy: kes.Identity("root")}
+	if err := enclave.SetPolicy(ctx, "my-policy", policy); err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+	if policy.Version != 1 {
+		t.Fatalf("policy.Version = %d, want 1", policy.Version)
+	}
+	if len(policy.Signature) == 0 {
+		t.Fatal("policy.Signature is empty after SetPolicy")
+	}
+
+	updated := &Policy{Allow: []string{"GET /v1/key/*", "POST /v1/key/create/*"}, CreatedBy: kes.Identity("root")}
+	if err := enclave.SetPolicy(ctx, "my-policy", updated); err != nil {
+		t.Fatalf("SetPolicy (update): %v", err)
+	}
+	if updated.Version != 2 {
+		t.Fatalf("updated.Version = %d, want 2", updated.Version)
+	}
+
+	v1, err := enclave.GetPolicyVersion(ctx, "my-policy", 1)
+	if err != nil {
+		t.Fatalf("GetPolicyVersion(1): %v", err)
+	}
+	if len(v1.Allow) != 1 {
+		t.Fatalf("GetPolicyVersion(1).Allow = %v, want the original single-rule version", v1.Allow)
+	}
+
+	history, err := enclave.ListPolicyVersions(ctx, "my-policy")
+	if err != nil {
+		t.Fatalf("ListPolicyVersions: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("len(history) = %d, want 2", len(history))
+	}
+}
+
+func TestEnclaveSignatureCoversVersionAndAuthorship(t *testing.T) {
+	ctx := context.Background()
+	enclave := NewEnclave([]byte("test-signing-key"))
+
+	policy := &Policy{Allow: []string{"GET /v1/key/*"}, CreatedBy: kes.Identity("root")}
+	if err := enclave.SetPolicy(ctx, "my-policy", policy); err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+	original, err := canonicalize("my-policy", policy)
+	if err != nil {
+		t.Fatalf("canonicalize: %v", err)
+	}
+
+	tampered := *policy
+	tampered.CreatedBy = kes.Identity("someone-else")
+	forged, err := canonicalize("my-policy", &tampered)
+	if err != nil {
+		t.Fatalf("canonicalize: %v", err)
+	}
+	if string(original) == string(forged) {
+		t.Fatal("canonicalize ignored CreatedBy - a forged version would keep the same signature")
+	}
+
+	tampered = *policy
+	tampered.Version++
+	forged, err = canonicalize("my-policy", &tampered)
+	if err != nil {
+		t.Fatalf("canonicalize: %v", err)
+	}
+	if string(original) == string(forged) {
+		t.Fatal("canonicalize ignored Version - a forged version would keep the same signature")
+	}
+}
+
+func TestEnclaveAssignAndDeleteIdentity(t *testing.T) {
+	ctx := context.Background()
+	enclave := NewEnclave([]byte("test-signing-key"))
+
+	policy := &Policy{Allow: []string{"GET /v1/key/*"}, CreatedBy: kes.Identity("root")}
+	if err := enclave.SetPolicy(ctx, "my-policy", policy); err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+
+	events, cancel := enclave.Identities.Subscribe()
+	defer cancel()
+
+	if err := enclave.AssignPolicy(ctx, "my-policy", kes.Identity("alice"), kes.Identity("root")); err != nil {
+		t.Fatalf("AssignPolicy: %v", err)
+	}
+	if name, err := enclave.IdentityPolicyName(ctx, kes.Identity("alice")); err != nil || name != "my-policy" {
+		t.Fatalf("IdentityPolicyName(alice) = (%q, %v), want (my-policy, nil)", name, err)
+	}
+
+	event := <-events
+	if event.Op != "put" || event.Name != "my-policy" || event.Identity != kes.Identity("alice") || event.CreatedBy != kes.Identity("root") {
+		t.Fatalf("unexpected assign event: %+v", event)
+	}
+
+	if err := enclave.DeleteIdentity(ctx, kes.Identity("alice"), kes.Identity("root")); err != nil {
+		t.Fatalf("DeleteIdentity: %v", err)
+	}
+	if _, err := enclave.IdentityPolicyName(ctx, kes.Identity("alice")); err == nil {
+		t.Fatal("IdentityPolicyName(alice) succeeded after DeleteIdentity, want an error")
+	}
+
+	event = <-events
+	if event.Op != "delete" || event.Name != "my-policy" || event.Identity != kes.Identity("alice") || event.CreatedBy != kes.Identity("root") {
+		t.Fatalf("unexpected delete event: %+v", event)
+	}
+}
+
+func TestEnclaveListIdentitiesPagination(t *testing.T) {
+	ctx := context.Background()
+	enclave := NewEnclave([]byte("test-signing-key"))
+
+	policy := &Policy{Allow: []string{"GET /v1/key/*"}, CreatedBy: kes.Identity("root")}
+	if err := enclave.SetPolicy(ctx, "my-policy", policy); err != nil {
+		t.Fatalf("SetPolicy: %v", err)
+	}
+	for _, identity := range []kes.Identity{"alice", "bob", "carol"} {
+		if err := enclave.AssignPolicy(ctx, "my-policy", identity, kes.Identity("root")); err != nil {
+			t.Fatalf("AssignPolicy(%s): %v", identity, err)
+		}
+	}
+
+	iterator, continueAt, err := enclave.ListIdentities(ctx, "", "", 2)
+	if err != nil {
+		t.Fatalf("ListIdentities (page 1): %v", err)
+	}
+	var page1 []kes.Identity
+	for iterator.Next() {
+		page1 = append(page1, iterator.Identity())
+	}
+	if err = iterator.Close(); err != nil {
+		t.Fatalf("iterator.Close: %v", err)
+	}
+	if len(page1) != 2 || continueAt == "" {
+		t.Fatalf("page 1 = %v, continueAt = %q, want 2 identities and a continuation token", page1, continueAt)
+	}
+
+	iterator, continueAt, err = enclave.ListIdentities(ctx, "", continueAt, 2)
+	if err != nil {
+		t.Fatalf("ListIdentities (page 2): %v", err)
+	}
+	var page2 []kes.Identity
+	for iterator.Next() {
+		page2 = append(page2, iterator.Identity())
+	}
+	if err = iterator.Close(); err != nil {
+		t.Fatalf("iterator.Close: %v", err)
+	}
+	if len(page2) != 1 || continueAt != "" {
+		t.Fatalf("page 2 = %v, continueAt = %q, want the single remaining identity and no continuation token", page2, continueAt)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+// Package authz implements an optional external policy decision
+// point that KES consults in addition to its own, static allow/deny
+// policies.
+package authz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Decision describes a single access decision request sent to an
+// external authorizer.
+type Decision struct {
+	Identity string            `json:"identity"`
+	Policy   string            `json:"policy,omitempty"`
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Enclave  string            `json:"enclave,omitempty"`
+}
+
+// Result is the outcome of a Decision as returned by an external
+// authorizer.
+type Result struct {
+	Allow       bool              `json:"allow"`
+	Obligations map[string]string `json:"obligations,omitempty"`
+}
+
+// AuthorizerConfig configures how KES reaches an external policy
+// decision point over HTTP. An embedded Rego evaluator is not
+// supported. New turns it into the Authorizer that is set as
+// ServerConfig.Authorizer to enable the external authorizer for a
+// server.
+type AuthorizerConfig struct {
+	// Endpoint is the URL of the external authorizer. It receives
+	// a Decision as a JSON-encoded POST body and must respond with
+	// a JSON-encoded Result.
+	Endpoint string
+
+	// Timeout bounds how long KES waits for a decision before
+	// failing the request.
+	Timeout time.Duration
+
+	// CacheTTL is how long a Result is cached for a given
+	// (identity, policy, method, path) tuple. A zero value disables
+	// caching.
+	CacheTTL time.Duration
+}
+
+// Authorizer consults an external decision point for access
+// decisions that go beyond KES's built-in allow/deny policies -
+// e.g. time-of-day, source IP or request-rate rules.
+type Authorizer struct {
+	config AuthorizerConfig
+	client *http.Client
+
+	lock  sync.Mutex
+	cache map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	result  Result
+	expires time.Time
+}
+
+// New returns an Authorizer for the given config, or nil if
+// config.Endpoint is empty. A nil *Authorizer is safe to call
+// Authorize on and always allows the request - callers use it to
+// represent "no external authorizer configured".
+func New(config AuthorizerConfig) *Authorizer {
+	if config.Endpoint == "" {
+		return nil
+	}
+	return &Authorizer{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		cache:  map[string]cacheEntry{},
+	}
+}
+
+// Authorize sends decision to the external decision point and
+// returns its result. Results are cached per (identity, policy,
+// method, path) for config.CacheTTL to keep the hot request path fast.
+func (a *Authorizer) Authorize(ctx context.Context, decision Decision) (Result, error) {
+	if a == nil {
+		return Result{Allow: true}, nil
+	}
+
+	key := decision.Identity + "\x00" + decision.Policy + "\x00" + decision.Method + "\x00" + decision.Path
+	if result, ok := a.lookup(key); ok {
+		return result, nil
+	}
+
+	body, err := json.Marshal(decision)
+	if err != nil {
+		return Result{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	var result Result
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return Result{}, err
+	}
+	a.store(key, result)
+	return result, nil
+}
+
+func (a *Authorizer) lookup(key string) (Result, bool) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	entry, ok := a.cache[key]
+	if !ok || time.Now().After(entry.expires) {
+		return Result{}, false
+	}
+	return entry.result, true
+}
+
+func (a *Authorizer) store(key string, result Result) {
+	if a.config.CacheTTL <= 0 {
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.cache[key] = cacheEntry{result: result, expires: time.Now().Add(a.config.CacheTTL)}
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewReturnsNilWithoutEndpoint(t *testing.T) {
+	if a := New(AuthorizerConfig{}); a != nil {
+		t.Fatalf("New(AuthorizerConfig{}) = %v, want nil", a)
+	}
+}
+
+func TestNilAuthorizerAlwaysAllows(t *testing.T) {
+	var a *Authorizer
+	result, err := a.Authorize(context.Background(), Decision{})
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if !result.Allow {
+		t.Fatal("a nil Authorizer should always allow")
+	}
+}
+
+func TestAuthorizeCachesPerIdentityPolicyMethodPath(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var decision Decision
+		json.NewDecoder(r.Body).Decode(&decision)
+		json.NewEncoder(w).Encode(Result{Allow: decision.Policy == "policy-a"})
+	}))
+	defer server.Close()
+
+	a := New(AuthorizerConfig{Endpoint: server.URL, Timeout: 5 * time.Second, CacheTTL: time.Minute})
+	ctx := context.Background()
+
+	result, err := a.Authorize(ctx, Decision{Identity: "bob", Policy: "policy-a", Method: "GET", Path: "/v1/policy/simulate/"})
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if !result.Allow {
+		t.Fatal("expected policy-a to be allowed")
+	}
+
+	// Same identity/method/path but a different resolved policy must
+	// not reuse policy-a's cached decision.
+	result, err = a.Authorize(ctx, Decision{Identity: "bob", Policy: "policy-b", Method: "GET", Path: "/v1/policy/simulate/"})
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if result.Allow {
+		t.Fatal("policy-b decision incorrectly reused policy-a's cached allow")
+	}
+	if requests != 2 {
+		t.Fatalf("requests = %d, want 2 (no cache hit across different policies)", requests)
+	}
+
+	// Repeating the first decision should now be served from cache.
+	if _, err = a.Authorize(ctx, Decision{Identity: "bob", Policy: "policy-a", Method: "GET", Path: "/v1/policy/simulate/"}); err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if requests != 2 {
+		t.Fatalf("requests = %d, want 2 (repeated decision should hit the cache)", requests)
+	}
+}
+
+func TestAuthorizeCacheExpires(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(Result{Allow: true})
+	}))
+	defer server.Close()
+
+	a := New(AuthorizerConfig{Endpoint: server.URL, Timeout: 5 * time.Second, CacheTTL: time.Nanosecond})
+	ctx := context.Background()
+	decision := Decision{Identity: "bob", Policy: "policy-a", Method: "GET", Path: "/v1/policy/simulate/"}
+
+	if _, err := a.Authorize(ctx, decision); err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := a.Authorize(ctx, decision); err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	if requests != 2 {
+		t.Fatalf("requests = %d, want 2 (expired cache entry should not be reused)", requests)
+	}
+}
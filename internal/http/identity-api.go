@@ -0,0 +1,262 @@
+// Copyright 2022 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/kes"
+	"github.com/minio/kes/internal/auth"
+)
+
+// watchIdentity streams identity-to-policy assignment changes as
+// they happen, mirroring watchPolicy in policy-api.go.
+func watchIdentity(mux *http.ServeMux, config *ServerConfig) API {
+	const (
+		Method      = http.MethodGet
+		APIPath     = "/v1/identity/watch/"
+		MaxBody     = 0
+		Timeout     = 0 // long-lived stream - no request timeout
+		ContentType = "application/x-ndjson"
+	)
+	type Response struct {
+		Op        string       `json:"op"`
+		Name      string       `json:"name"`
+		Identity  kes.Identity `json:"identity,omitempty"`
+		CreatedAt time.Time    `json:"created_at,omitempty"`
+		CreatedBy kes.Identity `json:"created_by,omitempty"`
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w = audit(w, r, config.AuditLog.Log())
+
+		if r.Method != Method {
+			w.Header().Set("Accept", Method)
+			Error(w, errMethodNotAllowed)
+			return
+		}
+		if err := normalizeURL(r.URL, APIPath); err != nil {
+			Error(w, err)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBody)
+
+		enclave, err := lookupEnclave(config.Vault, r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		if err = enclave.VerifyRequest(r); err != nil {
+			Error(w, err)
+			return
+		}
+		if err = authorizeExternal(r, config, ""); err != nil {
+			Error(w, err)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			Error(w, kes.NewError(http.StatusInternalServerError, "streaming not supported"))
+			return
+		}
+
+		events, cancel := enclave.Identities.Subscribe()
+		defer cancel()
+
+		encoder := json.NewEncoder(w)
+		w.Header().Set("Content-Type", ContentType)
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if err := encoder.Encode(Response{
+					Op:        event.Op,
+					Name:      event.Name,
+					Identity:  event.Identity,
+					CreatedAt: event.CreatedAt,
+					CreatedBy: event.CreatedBy,
+				}); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+	mux.HandleFunc(APIPath, config.Metrics.Count(config.Metrics.Latency(handler)))
+	return API{
+		Method:  Method,
+		Path:    APIPath,
+		MaxBody: MaxBody,
+		Timeout: Timeout,
+	}
+}
+
+// deleteIdentity removes the policy assigned to an identity, mirroring
+// deletePolicy in policy-api.go.
+func deleteIdentity(mux *http.ServeMux, config *ServerConfig) API {
+	const (
+		Method  = http.MethodDelete
+		APIPath = "/v1/identity/delete/"
+		MaxBody = 0
+		Timeout = 15 * time.Second
+	)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w = audit(w, r, config.AuditLog.Log())
+
+		if r.Method != Method {
+			w.Header().Set("Accept", Method)
+			Error(w, errMethodNotAllowed)
+			return
+		}
+		if err := normalizeURL(r.URL, APIPath); err != nil {
+			Error(w, err)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBody)
+
+		enclave, err := lookupEnclave(config.Vault, r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		if err = enclave.VerifyRequest(r); err != nil {
+			Error(w, err)
+			return
+		}
+
+		identity := kes.Identity(strings.TrimSpace(strings.TrimPrefix(r.URL.Path, APIPath)))
+		if identity.IsUnknown() {
+			Error(w, kes.NewError(http.StatusBadRequest, "identity is unknown"))
+			return
+		}
+		if err = authorizeExternal(r, config, ""); err != nil {
+			Error(w, err)
+			return
+		}
+
+		self := auth.Identify(r)
+		if self == identity {
+			Error(w, kes.NewError(http.StatusForbidden, "identity cannot delete its own policy assignment"))
+			return
+		}
+		if err = enclave.DeleteIdentity(r.Context(), identity, self); err != nil {
+			Error(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	mux.HandleFunc(APIPath, timeout(Timeout, proxy(config.Proxy, config.Metrics.Count(config.Metrics.Latency(handler)))))
+	return API{
+		Method:  Method,
+		Path:    APIPath,
+		MaxBody: MaxBody,
+		Timeout: Timeout,
+	}
+}
+
+// listIdentity lists identity-to-policy assignments a page at a
+// time, mirroring listPolicy in policy-api.go.
+func listIdentity(mux *http.ServeMux, config *ServerConfig) API {
+	const (
+		Method      = http.MethodGet
+		APIPath     = "/v1/identity/list/"
+		MaxBody     = 0
+		Timeout     = 15 * time.Second
+		ContentType = "application/json"
+	)
+	type Item struct {
+		Identity kes.Identity `json:"identity"`
+		Policy   string       `json:"policy"`
+	}
+	type Response struct {
+		Items      []Item `json:"items"`
+		ContinueAt string `json:"continue_at,omitempty"`
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w = audit(w, r, config.AuditLog.Log())
+
+		if r.Method != Method {
+			w.Header().Set("Accept", Method)
+			Error(w, errMethodNotAllowed)
+			return
+		}
+		if err := normalizeURL(r.URL, APIPath); err != nil {
+			Error(w, err)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBody)
+
+		enclave, err := lookupEnclave(config.Vault, r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		if err = enclave.VerifyRequest(r); err != nil {
+			Error(w, err)
+			return
+		}
+		if err = authorizeExternal(r, config, ""); err != nil {
+			Error(w, err)
+			return
+		}
+
+		query := r.URL.Query()
+		prefix := query.Get("prefix")
+		continueAt := query.Get("continue")
+
+		limit := defaultListLimit
+		if raw := query.Get("limit"); raw != "" {
+			limit, err = strconv.Atoi(raw)
+			if err != nil || limit <= 0 {
+				Error(w, kes.NewError(http.StatusBadRequest, "limit is not a positive number"))
+				return
+			}
+			if limit > maxListLimit {
+				limit = maxListLimit
+			}
+		}
+
+		iterator, continueAt, err := enclave.ListIdentities(r.Context(), prefix, continueAt, limit)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		items := make([]Item, 0, limit)
+		for iterator.Next() {
+			items = append(items, Item{
+				Identity: iterator.Identity(),
+				Policy:   iterator.Policy(),
+			})
+		}
+		if err = iterator.Close(); err != nil {
+			Error(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentType)
+		json.NewEncoder(w).Encode(Response{
+			Items:      items,
+			ContinueAt: continueAt,
+		})
+	}
+	mux.HandleFunc(APIPath, timeout(Timeout, proxy(config.Proxy, config.Metrics.Count(config.Metrics.Latency(handler)))))
+	return API{
+		Method:  Method,
+		Path:    APIPath,
+		MaxBody: MaxBody,
+		Timeout: Timeout,
+	}
+}
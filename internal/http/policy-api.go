@@ -7,14 +7,39 @@ package http
 import (
 	"encoding/json"
 	"net/http"
-	"path"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/minio/kes"
 	"github.com/minio/kes/internal/auth"
+	"github.com/minio/kes/internal/authz"
 )
 
+// authorizeExternal consults config.Authorizer, if one is
+// configured, after the built-in policy check has already allowed
+// the request. It lets operators layer contextual rules - such as
+// time-of-day, source IP or key-name regexes - on top of the static
+// allow/deny lists without recompiling KES.
+func authorizeExternal(r *http.Request, config *ServerConfig, policy string) error {
+	if config.Authorizer == nil {
+		return nil
+	}
+	result, err := config.Authorizer.Authorize(r.Context(), authz.Decision{
+		Identity: string(auth.Identify(r)),
+		Policy:   policy,
+		Method:   r.Method,
+		Path:     r.URL.Path,
+	})
+	if err != nil {
+		return err
+	}
+	if !result.Allow {
+		return kes.NewError(http.StatusForbidden, "access denied by external authorizer")
+	}
+	return nil
+}
+
 func describePolicy(mux *http.ServeMux, config *ServerConfig) API {
 	const (
 		Method      = http.MethodGet
@@ -56,6 +81,10 @@ func describePolicy(mux *http.ServeMux, config *ServerConfig) API {
 			Error(w, err)
 			return
 		}
+		if err = authorizeExternal(r, config, name); err != nil {
+			Error(w, err)
+			return
+		}
 		policy, err := enclave.GetPolicy(r.Context(), name)
 		if err != nil {
 			Error(w, err)
@@ -76,6 +105,110 @@ func describePolicy(mux *http.ServeMux, config *ServerConfig) API {
 	}
 }
 
+func simulatePolicy(mux *http.ServeMux, config *ServerConfig) API {
+	const (
+		Method      = http.MethodPost
+		APIPath     = "/v1/policy/simulate/"
+		MaxBody     = 1 << 20
+		Timeout     = 15 * time.Second
+		ContentType = "application/json"
+	)
+	type Request struct {
+		Identity kes.Identity `json:"identity,omitempty"`
+		Requests []struct {
+			Method string `json:"method"`
+			Path   string `json:"path"`
+		} `json:"requests"`
+	}
+	type Result struct {
+		Method string `json:"method"`
+		Path   string `json:"path"`
+		Allow  bool   `json:"allow"`
+		Rule   string `json:"rule,omitempty"`
+	}
+	type Response struct {
+		Results []Result `json:"results"`
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w = audit(w, r, config.AuditLog.Log())
+
+		if r.Method != Method {
+			w.Header().Set("Accept", Method)
+			Error(w, errMethodNotAllowed)
+			return
+		}
+		if err := normalizeURL(r.URL, APIPath); err != nil {
+			Error(w, err)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBody)
+
+		enclave, err := lookupEnclave(config.Vault, r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		if err = enclave.VerifyRequest(r); err != nil {
+			Error(w, err)
+			return
+		}
+
+		var req Request
+		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
+			Error(w, err)
+			return
+		}
+
+		name := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, APIPath))
+		switch {
+		case name != "":
+			if err = validateName(name); err != nil {
+				Error(w, err)
+				return
+			}
+		case !req.Identity.IsUnknown():
+			name, err = enclave.IdentityPolicyName(r.Context(), req.Identity)
+			if err != nil {
+				Error(w, err)
+				return
+			}
+		default:
+			Error(w, kes.NewError(http.StatusBadRequest, "either a policy name or an identity must be given"))
+			return
+		}
+		if err = authorizeExternal(r, config, name); err != nil {
+			Error(w, err)
+			return
+		}
+
+		policy, err := enclave.GetPolicy(r.Context(), name)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		results := make([]Result, 0, len(req.Requests))
+		for _, sim := range req.Requests {
+			allow, rule := policy.Verify(sim.Method, sim.Path)
+			results = append(results, Result{
+				Method: sim.Method,
+				Path:   sim.Path,
+				Allow:  allow,
+				Rule:   rule,
+			})
+		}
+		w.Header().Set("Content-Type", ContentType)
+		json.NewEncoder(w).Encode(Response{Results: results})
+	}
+	mux.HandleFunc(APIPath, timeout(Timeout, proxy(config.Proxy, config.Metrics.Count(config.Metrics.Latency(handler)))))
+	return API{
+		Method:  Method,
+		Path:    APIPath,
+		MaxBody: MaxBody,
+		Timeout: Timeout,
+	}
+}
+
 func assignPolicy(mux *http.ServeMux, config *ServerConfig) API {
 	const (
 		Method  = http.MethodPost
@@ -114,6 +247,10 @@ func assignPolicy(mux *http.ServeMux, config *ServerConfig) API {
 			Error(w, err)
 			return
 		}
+		if err = authorizeExternal(r, config, name); err != nil {
+			Error(w, err)
+			return
+		}
 
 		var req Request
 		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -124,11 +261,12 @@ func assignPolicy(mux *http.ServeMux, config *ServerConfig) API {
 			Error(w, kes.NewError(http.StatusBadRequest, "identity is unknown"))
 			return
 		}
-		if self := auth.Identify(r); self == req.Identity {
+		self := auth.Identify(r)
+		if self == req.Identity {
 			Error(w, kes.NewError(http.StatusForbidden, "identity cannot assign policy to itself"))
 			return
 		}
-		if err = enclave.AssignPolicy(r.Context(), name, req.Identity); err != nil {
+		if err = enclave.AssignPolicy(r.Context(), name, req.Identity, self); err != nil {
 			Error(w, err)
 			return
 		}
@@ -156,6 +294,8 @@ func readPolicy(mux *http.ServeMux, config *ServerConfig) API {
 		Deny      []string     `json:"deny,omitempty"`
 		CreatedAt time.Time    `json:"created_at,omitempty"`
 		CreatedBy kes.Identity `json:"created_by,omitempty"`
+		Version   int          `json:"version,omitempty"`
+		Signature []byte       `json:"signature,omitempty"`
 	}
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		w = audit(w, r, config.AuditLog.Log())
@@ -186,17 +326,38 @@ func readPolicy(mux *http.ServeMux, config *ServerConfig) API {
 			Error(w, err)
 			return
 		}
-		policy, err := enclave.GetPolicy(r.Context(), name)
-		if err != nil {
+		if err = authorizeExternal(r, config, name); err != nil {
 			Error(w, err)
 			return
 		}
+
+		var policy *auth.Policy
+		if raw := r.URL.Query().Get("version"); raw != "" {
+			version, err := strconv.Atoi(raw)
+			if err != nil || version <= 0 {
+				Error(w, kes.NewError(http.StatusBadRequest, "version is not a positive number"))
+				return
+			}
+			policy, err = enclave.GetPolicyVersion(r.Context(), name, version)
+			if err != nil {
+				Error(w, err)
+				return
+			}
+		} else {
+			policy, err = enclave.GetPolicy(r.Context(), name)
+			if err != nil {
+				Error(w, err)
+				return
+			}
+		}
 		w.Header().Set("Content-Type", ContentType)
 		json.NewEncoder(w).Encode(Response{
 			Allow:     policy.Allow,
 			Deny:      policy.Deny,
 			CreatedAt: policy.CreatedAt,
 			CreatedBy: policy.CreatedBy,
+			Version:   policy.Version,
+			Signature: policy.Signature,
 		})
 	}
 	mux.HandleFunc(APIPath, timeout(Timeout, proxy(config.Proxy, config.Metrics.Count(config.Metrics.Latency(handler)))))
@@ -208,17 +369,102 @@ func readPolicy(mux *http.ServeMux, config *ServerConfig) API {
 	}
 }
 
+func policyHistory(mux *http.ServeMux, config *ServerConfig) API {
+	const (
+		Method      = http.MethodGet
+		APIPath     = "/v1/policy/history/"
+		MaxBody     = 0
+		Timeout     = 15 * time.Second
+		ContentType = "application/x-ndjson"
+	)
+	type Response struct {
+		Version   int          `json:"version"`
+		CreatedAt time.Time    `json:"created_at,omitempty"`
+		CreatedBy kes.Identity `json:"created_by,omitempty"`
+		Signature []byte       `json:"signature,omitempty"`
+		Hash      []byte       `json:"hash,omitempty"`
+
+		Err string `json:"error,omitempty"`
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w = audit(w, r, config.AuditLog.Log())
+
+		if r.Method != Method {
+			w.Header().Set("Accept", Method)
+			Error(w, errMethodNotAllowed)
+			return
+		}
+		if err := normalizeURL(r.URL, APIPath); err != nil {
+			Error(w, err)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBody)
+
+		enclave, err := lookupEnclave(config.Vault, r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		if err = enclave.VerifyRequest(r); err != nil {
+			Error(w, err)
+			return
+		}
+
+		name := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, APIPath))
+		if err = validateName(name); err != nil {
+			Error(w, err)
+			return
+		}
+		if err = authorizeExternal(r, config, name); err != nil {
+			Error(w, err)
+			return
+		}
+		history, err := enclave.ListPolicyVersions(r.Context(), name)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		encoder := json.NewEncoder(w)
+		w.Header().Set("Content-Type", ContentType)
+		for _, version := range history {
+			err = encoder.Encode(Response{
+				Version:   version.Version,
+				CreatedAt: version.CreatedAt,
+				CreatedBy: version.CreatedBy,
+				Signature: version.Signature,
+				Hash:      version.Hash,
+			})
+			if err != nil {
+				return
+			}
+		}
+	}
+	mux.HandleFunc(APIPath, timeout(Timeout, proxy(config.Proxy, config.Metrics.Count(config.Metrics.Latency(handler)))))
+	return API{
+		Method:  Method,
+		Path:    APIPath,
+		MaxBody: MaxBody,
+		Timeout: Timeout,
+	}
+}
+
 func writePolicy(mux *http.ServeMux, config *ServerConfig) API {
 	const (
-		Method  = http.MethodPost
-		APIPath = "/v1/policy/write/"
-		MaxBody = 1 << 20
-		Timeout = 15 * time.Second
+		Method      = http.MethodPost
+		APIPath     = "/v1/policy/write/"
+		MaxBody     = 1 << 20
+		Timeout     = 15 * time.Second
+		ContentType = "application/json"
 	)
 	type Request struct {
 		Allow []string `json:"allow,omitempty"`
 		Deny  []string `json:"deny,omitempty"`
 	}
+	type Response struct {
+		Version   int    `json:"version"`
+		Signature []byte `json:"signature,omitempty"`
+	}
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		w = audit(w, r, config.AuditLog.Log())
 
@@ -248,6 +494,10 @@ func writePolicy(mux *http.ServeMux, config *ServerConfig) API {
 			Error(w, err)
 			return
 		}
+		if err = authorizeExternal(r, config, name); err != nil {
+			Error(w, err)
+			return
+		}
 
 		var req Request
 		if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -264,7 +514,11 @@ func writePolicy(mux *http.ServeMux, config *ServerConfig) API {
 			Error(w, err)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		w.Header().Set("Content-Type", ContentType)
+		json.NewEncoder(w).Encode(Response{
+			Version:   policy.Version,
+			Signature: policy.Signature,
+		})
 	}
 	mux.HandleFunc(APIPath, timeout(Timeout, proxy(config.Proxy, config.Metrics.Count(config.Metrics.Latency(handler)))))
 	return API{
@@ -275,6 +529,92 @@ func writePolicy(mux *http.ServeMux, config *ServerConfig) API {
 	}
 }
 
+func watchPolicy(mux *http.ServeMux, config *ServerConfig) API {
+	const (
+		Method      = http.MethodGet
+		APIPath     = "/v1/policy/watch/"
+		MaxBody     = 0
+		Timeout     = 0 // long-lived stream - no request timeout
+		ContentType = "application/x-ndjson"
+	)
+	type Response struct {
+		Op        string       `json:"op"`
+		Name      string       `json:"name"`
+		Version   int          `json:"version,omitempty"`
+		CreatedAt time.Time    `json:"created_at,omitempty"`
+		CreatedBy kes.Identity `json:"created_by,omitempty"`
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w = audit(w, r, config.AuditLog.Log())
+
+		if r.Method != Method {
+			w.Header().Set("Accept", Method)
+			Error(w, errMethodNotAllowed)
+			return
+		}
+		if err := normalizeURL(r.URL, APIPath); err != nil {
+			Error(w, err)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBody)
+
+		enclave, err := lookupEnclave(config.Vault, r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		if err = enclave.VerifyRequest(r); err != nil {
+			Error(w, err)
+			return
+		}
+		if err = authorizeExternal(r, config, ""); err != nil {
+			Error(w, err)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			Error(w, kes.NewError(http.StatusInternalServerError, "streaming not supported"))
+			return
+		}
+
+		events, cancel := enclave.Policies.Subscribe()
+		defer cancel()
+
+		encoder := json.NewEncoder(w)
+		w.Header().Set("Content-Type", ContentType)
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if err := encoder.Encode(Response{
+					Op:        event.Op,
+					Name:      event.Name,
+					Version:   event.Version,
+					CreatedAt: event.CreatedAt,
+					CreatedBy: event.CreatedBy,
+				}); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+	mux.HandleFunc(APIPath, config.Metrics.Count(config.Metrics.Latency(handler)))
+	return API{
+		Method:  Method,
+		Path:    APIPath,
+		MaxBody: MaxBody,
+		Timeout: Timeout,
+	}
+}
+
 func deletePolicy(mux *http.ServeMux, config *ServerConfig) API {
 	const (
 		Method  = http.MethodDelete
@@ -311,6 +651,10 @@ func deletePolicy(mux *http.ServeMux, config *ServerConfig) API {
 			Error(w, err)
 			return
 		}
+		if err = authorizeExternal(r, config, name); err != nil {
+			Error(w, err)
+			return
+		}
 
 		if err = enclave.DeletePolicy(r.Context(), name); err != nil {
 			Error(w, err)
@@ -327,20 +671,31 @@ func deletePolicy(mux *http.ServeMux, config *ServerConfig) API {
 	}
 }
 
+// defaultListLimit is the number of entries returned by a list
+// request if the client does not specify a limit of its own.
+// maxListLimit is the largest limit a client may request in a
+// single page.
+const (
+	defaultListLimit = 200
+	maxListLimit     = 1000
+)
+
 func listPolicy(mux *http.ServeMux, config *ServerConfig) API {
 	const (
 		Method      = http.MethodGet
 		APIPath     = "/v1/policy/list/"
 		MaxBody     = 0
 		Timeout     = 15 * time.Second
-		ContentType = "application/x-ndjson"
+		ContentType = "application/json"
 	)
-	type Response struct {
+	type Item struct {
 		Name      string       `json:"name"`
 		CreatedAt time.Time    `json:"created_at,omitempty"`
 		CreatedBy kes.Identity `json:"created_by,omitempty"`
-
-		Err string `json:"error,omitempty"`
+	}
+	type Response struct {
+		Items      []Item `json:"items"`
+		ContinueAt string `json:"continue_at,omitempty"`
 	}
 	handler := func(w http.ResponseWriter, r *http.Request) {
 		w = audit(w, r, config.AuditLog.Log())
@@ -366,47 +721,56 @@ func listPolicy(mux *http.ServeMux, config *ServerConfig) API {
 			return
 		}
 
-		pattern := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, APIPath))
-		if err = validatePattern(pattern); err != nil {
+		if err = authorizeExternal(r, config, ""); err != nil {
 			Error(w, err)
 			return
 		}
-		iterator, err := enclave.ListPolicies(r.Context())
+
+		query := r.URL.Query()
+		prefix := query.Get("prefix")
+		continueAt := query.Get("continue")
+
+		limit := defaultListLimit
+		if raw := query.Get("limit"); raw != "" {
+			limit, err = strconv.Atoi(raw)
+			if err != nil || limit <= 0 {
+				Error(w, kes.NewError(http.StatusBadRequest, "limit is not a positive number"))
+				return
+			}
+			if limit > maxListLimit {
+				limit = maxListLimit
+			}
+		}
+
+		iterator, continueAt, err := enclave.ListPolicies(r.Context(), prefix, continueAt, limit)
 		if err != nil {
 			Error(w, err)
 			return
 		}
 
-		var hasWritten bool
-		encoder := json.NewEncoder(w)
-		w.Header().Set("Content-Type", ContentType)
+		items := make([]Item, 0, limit)
 		for iterator.Next() {
-			if ok, _ := path.Match(pattern, iterator.Name()); !ok {
-				continue
-			}
-
 			policy, err := enclave.GetPolicy(r.Context(), iterator.Name())
 			if err != nil {
-				encoder.Encode(Response{Err: err.Error()})
+				Error(w, err)
 				return
 			}
-			err = encoder.Encode(Response{
+			items = append(items, Item{
 				Name:      iterator.Name(),
 				CreatedAt: policy.CreatedAt,
 				CreatedBy: policy.CreatedBy,
 			})
-			if err != nil {
-				return
-			}
-			hasWritten = true
 		}
 		if err = iterator.Close(); err != nil {
-			encoder.Encode(Response{Err: err.Error()})
+			Error(w, err)
 			return
 		}
-		if !hasWritten {
-			w.WriteHeader(http.StatusOK)
-		}
+
+		w.Header().Set("Content-Type", ContentType)
+		json.NewEncoder(w).Encode(Response{
+			Items:      items,
+			ContinueAt: continueAt,
+		})
 	}
 	mux.HandleFunc(APIPath, timeout(Timeout, proxy(config.Proxy, config.Metrics.Count(config.Metrics.Latency(handler)))))
 	return API{
@@ -0,0 +1,486 @@
+// Copyright 2022 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+
+	"github.com/minio/kes"
+	"github.com/minio/kes/internal/auth"
+)
+
+// Archive key-derivation parameters. These are fixed so that any
+// KES server can import an archive produced by another one as long
+// as the passphrase matches.
+const (
+	archiveSaltSize  = 16
+	archiveNonceSize = 12 // AES-GCM standard nonce size
+	archiveKeySize   = 32 // AES-256
+
+	argonTime    = 1
+	argonMemory  = 64 * 1024 // KiB
+	argonThreads = 4
+)
+
+// archiveHeader is stored, JSON-encoded, as the first line of an
+// export archive. It carries everything a reader needs to derive
+// the same AES-256-GCM key from the operator-supplied passphrase.
+type archiveHeader struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+}
+
+// archivePolicy is the on-disk representation of a single policy
+// document inside an export archive.
+type archivePolicy struct {
+	Name      string       `json:"name"`
+	Allow     []string     `json:"allow,omitempty"`
+	Deny      []string     `json:"deny,omitempty"`
+	CreatedAt time.Time    `json:"created_at,omitempty"`
+	CreatedBy kes.Identity `json:"created_by,omitempty"`
+	Version   int          `json:"version,omitempty"`
+	Signature []byte       `json:"signature,omitempty"`
+}
+
+// archiveIdentity is the on-disk representation of a single
+// identity-to-policy assignment inside an export archive.
+type archiveIdentity struct {
+	Identity kes.Identity `json:"identity"`
+	Policy   string       `json:"policy"`
+}
+
+func deriveArchiveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, argonTime, argonMemory, argonThreads, archiveKeySize)
+}
+
+// encryptArchive encrypts plaintext with a key derived from
+// passphrase and writes the resulting archive - header followed by
+// ciphertext - to w.
+func encryptArchive(w io.Writer, passphrase string, plaintext []byte) error {
+	salt := make([]byte, archiveSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	nonce := make([]byte, archiveNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	block, err := aes.NewCipher(deriveArchiveKey(passphrase, salt))
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	header, err := json.Marshal(archiveHeader{Salt: salt, Nonce: nonce})
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(append(header, '\n')); err != nil {
+		return err
+	}
+	_, err = w.Write(gcm.Seal(nil, nonce, plaintext, nil))
+	return err
+}
+
+// decryptArchive reads an archive produced by encryptArchive and
+// returns its plaintext contents.
+func decryptArchive(r io.Reader, passphrase string) ([]byte, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.IndexByte(content, '\n')
+	if i < 0 {
+		return nil, kes.NewError(http.StatusBadRequest, "invalid archive: missing header")
+	}
+
+	var header archiveHeader
+	if err = json.Unmarshal(content[:i], &header); err != nil {
+		return nil, kes.NewError(http.StatusBadRequest, "invalid archive: malformed header")
+	}
+
+	block, err := aes.NewCipher(deriveArchiveKey(passphrase, header.Salt))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(header.Nonce) != gcm.NonceSize() {
+		return nil, kes.NewError(http.StatusBadRequest, "invalid archive: wrong passphrase or corrupted archive")
+	}
+	plaintext, err := gcm.Open(nil, header.Nonce, content[i+1:], nil)
+	if err != nil {
+		return nil, kes.NewError(http.StatusBadRequest, "invalid archive: wrong passphrase or corrupted archive")
+	}
+	return plaintext, nil
+}
+
+// marshalArchive packs policies and identity assignments into a tar
+// archive of independent, named JSON entries so that future versions
+// can add further entries without breaking readers of this one.
+func marshalArchive(policies []archivePolicy, identities []archiveIdentity) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := writeArchiveEntry(tw, "policies.json", policies); err != nil {
+		return nil, err
+	}
+	if err := writeArchiveEntry(tw, "identities.json", identities); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeArchiveEntry(tw *tar.Writer, name string, v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err = tw.WriteHeader(&tar.Header{
+		Name: name,
+		Size: int64(len(content)),
+		Mode: 0o600,
+	}); err != nil {
+		return err
+	}
+	_, err = tw.Write(content)
+	return err
+}
+
+// unmarshalArchive unpacks the tar archive produced by
+// marshalArchive. The identities.json entry is optional, so that an
+// archive produced before identity assignments were exported can
+// still be imported.
+func unmarshalArchive(archive []byte) ([]archivePolicy, []archiveIdentity, error) {
+	var (
+		policies   []archivePolicy
+		identities []archiveIdentity
+		foundFiles bool
+	)
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, kes.NewError(http.StatusBadRequest, "invalid archive: "+err.Error())
+		}
+
+		switch header.Name {
+		case "policies.json":
+			if err = json.NewDecoder(tr).Decode(&policies); err != nil {
+				return nil, nil, kes.NewError(http.StatusBadRequest, "invalid archive: malformed policies.json")
+			}
+			foundFiles = true
+		case "identities.json":
+			if err = json.NewDecoder(tr).Decode(&identities); err != nil {
+				return nil, nil, kes.NewError(http.StatusBadRequest, "invalid archive: malformed identities.json")
+			}
+		}
+	}
+	if !foundFiles {
+		return nil, nil, kes.NewError(http.StatusBadRequest, "invalid archive: no policies found")
+	}
+	return policies, identities, nil
+}
+
+func exportPolicy(mux *http.ServeMux, config *ServerConfig) API {
+	const (
+		Method      = http.MethodGet
+		APIPath     = "/v1/policy/export"
+		MaxBody     = 0
+		Timeout     = 30 * time.Second
+		ContentType = "application/octet-stream"
+	)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w = audit(w, r, config.AuditLog.Log())
+
+		if r.Method != Method {
+			w.Header().Set("Accept", Method)
+			Error(w, errMethodNotAllowed)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBody)
+
+		enclave, err := lookupEnclave(config.Vault, r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		if err = enclave.VerifyRequest(r); err != nil {
+			Error(w, err)
+			return
+		}
+		if err = authorizeExternal(r, config, ""); err != nil {
+			Error(w, err)
+			return
+		}
+
+		passphrase := r.Header.Get("Archive-Passphrase")
+		if passphrase == "" {
+			Error(w, kes.NewError(http.StatusBadRequest, "no archive passphrase given"))
+			return
+		}
+
+		iterator, _, err := enclave.ListPolicies(r.Context(), "", "", 0)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		var policies []archivePolicy
+		for iterator.Next() {
+			policy, err := enclave.GetPolicy(r.Context(), iterator.Name())
+			if err != nil {
+				Error(w, err)
+				return
+			}
+			policies = append(policies, archivePolicy{
+				Name:      iterator.Name(),
+				Allow:     policy.Allow,
+				Deny:      policy.Deny,
+				CreatedAt: policy.CreatedAt,
+				CreatedBy: policy.CreatedBy,
+				Version:   policy.Version,
+				Signature: policy.Signature,
+			})
+		}
+		if err = iterator.Close(); err != nil {
+			Error(w, err)
+			return
+		}
+
+		identityIterator, _, err := enclave.ListIdentities(r.Context(), "", "", 0)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		var identities []archiveIdentity
+		for identityIterator.Next() {
+			identities = append(identities, archiveIdentity{
+				Identity: identityIterator.Identity(),
+				Policy:   identityIterator.Policy(),
+			})
+		}
+		if err = identityIterator.Close(); err != nil {
+			Error(w, err)
+			return
+		}
+
+		plaintext, err := marshalArchive(policies, identities)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentType)
+		w.Header().Set("Content-Disposition", `attachment; filename="kes-policies.archive"`)
+		if err = encryptArchive(w, passphrase, plaintext); err != nil {
+			Error(w, err)
+			return
+		}
+	}
+	mux.HandleFunc(APIPath, timeout(Timeout, config.Metrics.Count(config.Metrics.Latency(handler))))
+	return API{
+		Method:  Method,
+		Path:    APIPath,
+		MaxBody: MaxBody,
+		Timeout: Timeout,
+	}
+}
+
+// appliedPolicy records enough state about a policy that importPolicy
+// has already written to undo that write on a later failure -
+// restoring the previous policy if one existed, or deleting the
+// newly created one if it didn't.
+type appliedPolicy struct {
+	name        string
+	hadPrevious bool
+	previous    *auth.Policy
+}
+
+// rollbackPolicies undoes the writes recorded by applied, in order,
+// and returns the first error encountered, if any, so that callers
+// can surface a partial rollback instead of discarding it.
+func rollbackPolicies(ctx context.Context, enclave *auth.Enclave, applied []appliedPolicy) error {
+	var rollbackErr error
+	for _, a := range applied {
+		var err error
+		if a.hadPrevious {
+			err = enclave.SetPolicy(ctx, a.name, a.previous)
+		} else {
+			err = enclave.DeletePolicy(ctx, a.name)
+		}
+		if err != nil && rollbackErr == nil {
+			rollbackErr = err
+		}
+	}
+	return rollbackErr
+}
+
+// appliedIdentity records enough state about an identity assignment
+// that importPolicy has already written to undo that write on a
+// later failure.
+type appliedIdentity struct {
+	identity    kes.Identity
+	hadPrevious bool
+	previous    string
+}
+
+// rollbackIdentities undoes the assignments recorded by applied, in
+// order, and returns the first error encountered, if any. createdBy
+// is the identity performing the rollback, recorded on the resulting
+// Events.
+func rollbackIdentities(ctx context.Context, enclave *auth.Enclave, applied []appliedIdentity, createdBy kes.Identity) error {
+	var rollbackErr error
+	for _, a := range applied {
+		var err error
+		if a.hadPrevious {
+			err = enclave.AssignPolicy(ctx, a.previous, a.identity, createdBy)
+		} else {
+			err = enclave.DeleteIdentity(ctx, a.identity, createdBy)
+		}
+		if err != nil && rollbackErr == nil {
+			rollbackErr = err
+		}
+	}
+	return rollbackErr
+}
+
+func importPolicy(mux *http.ServeMux, config *ServerConfig) API {
+	const (
+		Method      = http.MethodPost
+		APIPath     = "/v1/policy/import"
+		MaxBody     = 32 << 20
+		Timeout     = 30 * time.Second
+		ContentType = "application/json"
+	)
+	type Response struct {
+		Imported          int  `json:"imported"`
+		IdentitiesUpdated int  `json:"identities_updated,omitempty"`
+		DryRun            bool `json:"dry_run,omitempty"`
+	}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w = audit(w, r, config.AuditLog.Log())
+
+		if r.Method != Method {
+			w.Header().Set("Accept", Method)
+			Error(w, errMethodNotAllowed)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBody)
+
+		enclave, err := lookupEnclave(config.Vault, r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		if err = enclave.VerifyRequest(r); err != nil {
+			Error(w, err)
+			return
+		}
+		if err = authorizeExternal(r, config, ""); err != nil {
+			Error(w, err)
+			return
+		}
+
+		passphrase := r.Header.Get("Archive-Passphrase")
+		if passphrase == "" {
+			Error(w, kes.NewError(http.StatusBadRequest, "no archive passphrase given"))
+			return
+		}
+		dryRun := r.URL.Query().Get("dry_run") == "1"
+
+		plaintext, err := decryptArchive(r.Body, passphrase)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		policies, identities, err := unmarshalArchive(plaintext)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		for _, p := range policies {
+			if err = validateName(p.Name); err != nil {
+				Error(w, kes.NewError(http.StatusBadRequest, "invalid archive: "+err.Error()))
+				return
+			}
+		}
+		if dryRun {
+			w.Header().Set("Content-Type", ContentType)
+			json.NewEncoder(w).Encode(Response{Imported: len(policies), IdentitiesUpdated: len(identities), DryRun: true})
+			return
+		}
+
+		applied := make([]appliedPolicy, 0, len(policies))
+		for _, p := range policies {
+			previous, getErr := enclave.GetPolicy(r.Context(), p.Name)
+			policy := &auth.Policy{
+				Allow:     p.Allow,
+				Deny:      p.Deny,
+				CreatedAt: p.CreatedAt,
+				CreatedBy: p.CreatedBy,
+			}
+			if err = enclave.SetPolicy(r.Context(), p.Name, policy); err != nil {
+				if rollbackErr := rollbackPolicies(r.Context(), enclave, applied); rollbackErr != nil {
+					Error(w, kes.NewError(http.StatusInternalServerError, "import failed and rollback was incomplete: "+rollbackErr.Error()))
+					return
+				}
+				Error(w, err)
+				return
+			}
+			applied = append(applied, appliedPolicy{name: p.Name, hadPrevious: getErr == nil, previous: previous})
+		}
+
+		self := auth.Identify(r)
+		appliedIdentities := make([]appliedIdentity, 0, len(identities))
+		for _, a := range identities {
+			previous, getErr := enclave.IdentityPolicyName(r.Context(), a.Identity)
+			if err = enclave.AssignPolicy(r.Context(), a.Policy, a.Identity, self); err != nil {
+				rollbackErr := rollbackIdentities(r.Context(), enclave, appliedIdentities, self)
+				if policyErr := rollbackPolicies(r.Context(), enclave, applied); policyErr != nil && rollbackErr == nil {
+					rollbackErr = policyErr
+				}
+				if rollbackErr != nil {
+					Error(w, kes.NewError(http.StatusInternalServerError, "import failed and rollback was incomplete: "+rollbackErr.Error()))
+					return
+				}
+				Error(w, err)
+				return
+			}
+			appliedIdentities = append(appliedIdentities, appliedIdentity{identity: a.Identity, hadPrevious: getErr == nil, previous: previous})
+		}
+
+		w.Header().Set("Content-Type", ContentType)
+		json.NewEncoder(w).Encode(Response{Imported: len(applied), IdentitiesUpdated: len(appliedIdentities)})
+	}
+	mux.HandleFunc(APIPath, timeout(Timeout, proxy(config.Proxy, config.Metrics.Count(config.Metrics.Latency(handler)))))
+	return API{
+		Method:  Method,
+		Path:    APIPath,
+		MaxBody: MaxBody,
+		Timeout: Timeout,
+	}
+}
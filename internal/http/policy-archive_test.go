@@ -0,0 +1,102 @@
+// Copyright 2022 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncryptDecryptArchiveRoundTrip(t *testing.T) {
+	plaintext := []byte("policies and identities")
+
+	var buf bytes.Buffer
+	if err := encryptArchive(&buf, "correct horse battery staple", plaintext); err != nil {
+		t.Fatalf("encryptArchive: %v", err)
+	}
+
+	got, err := decryptArchive(&buf, "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("decryptArchive: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("decryptArchive = %q, want %q", got, plaintext)
+	}
+}
+
+func TestDecryptArchiveWrongPassphrase(t *testing.T) {
+	var buf bytes.Buffer
+	if err := encryptArchive(&buf, "correct horse battery staple", []byte("secret")); err != nil {
+		t.Fatalf("encryptArchive: %v", err)
+	}
+
+	if _, err := decryptArchive(&buf, "wrong passphrase"); err == nil {
+		t.Fatal("decryptArchive succeeded with the wrong passphrase")
+	}
+}
+
+func TestDecryptArchiveRejectsTruncatedNonce(t *testing.T) {
+	var buf bytes.Buffer
+	if err := encryptArchive(&buf, "passphrase", []byte("secret")); err != nil {
+		t.Fatalf("encryptArchive: %v", err)
+	}
+
+	// Corrupt the header so its nonce is shorter than the cipher
+	// expects. Before the nonce-length guard this made gcm.Open
+	// panic instead of returning an error.
+	content := buf.Bytes()
+	i := bytes.IndexByte(content, '\n')
+	header := content[:i]
+	nonceAt := bytes.Index(header, []byte(`"nonce":"`))
+	if nonceAt < 0 {
+		t.Fatal("test archive header has no nonce field")
+	}
+	closeQuote := bytes.IndexByte(header[nonceAt+len(`"nonce":"`):], '"')
+	truncated := append(append([]byte{}, header[:nonceAt+len(`"nonce":"`)]...), header[nonceAt+len(`"nonce":"`)+closeQuote:]...)
+	corrupted := append(append(truncated, '\n'), content[i+1:]...)
+
+	if _, err := decryptArchive(bytes.NewReader(corrupted), "passphrase"); err == nil {
+		t.Fatal("decryptArchive accepted an archive with a truncated nonce")
+	}
+}
+
+func TestMarshalUnmarshalArchive(t *testing.T) {
+	policies := []archivePolicy{
+		{Name: "my-policy", Allow: []string{"GET /v1/key/*"}, Version: 1},
+	}
+	identities := []archiveIdentity{
+		{Identity: "aabbcc", Policy: "my-policy"},
+	}
+
+	archive, err := marshalArchive(policies, identities)
+	if err != nil {
+		t.Fatalf("marshalArchive: %v", err)
+	}
+
+	gotPolicies, gotIdentities, err := unmarshalArchive(archive)
+	if err != nil {
+		t.Fatalf("unmarshalArchive: %v", err)
+	}
+	if len(gotPolicies) != 1 || gotPolicies[0].Name != "my-policy" {
+		t.Fatalf("unmarshalArchive policies = %+v, want %+v", gotPolicies, policies)
+	}
+	if len(gotIdentities) != 1 || gotIdentities[0].Identity != "aabbcc" || gotIdentities[0].Policy != "my-policy" {
+		t.Fatalf("unmarshalArchive identities = %+v, want %+v", gotIdentities, identities)
+	}
+}
+
+func TestUnmarshalArchiveRejectsNonTarInput(t *testing.T) {
+	archive, err := marshalArchive(nil, nil)
+	if err != nil {
+		t.Fatalf("marshalArchive: %v", err)
+	}
+	if _, _, err := unmarshalArchive(archive); err != nil {
+		t.Fatalf("unmarshalArchive with empty policies should still succeed: %v", err)
+	}
+
+	if _, _, err := unmarshalArchive([]byte("not a tar archive")); err == nil {
+		t.Fatal("unmarshalArchive accepted a non-tar archive")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+// Package mem implements an in-memory store for versioned,
+// signed policy documents.
+package mem
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/minio/kes"
+)
+
+// ErrVersionNotFound is returned when a requested policy version
+// does not exist.
+var ErrVersionNotFound = errors.New("mem: policy version does not exist")
+
+// Version is one immutable, signed revision of a policy document.
+type Version struct {
+	Version   int
+	CreatedAt time.Time
+	CreatedBy kes.Identity
+	Hash      []byte
+	Signature []byte
+	Policy    []byte // canonicalized policy document
+}
+
+// Store is an in-memory store for the version history of policy
+// documents. Its zero value is ready to use.
+type Store struct {
+	lock     sync.RWMutex
+	versions map[string][]Version
+}
+
+// PutVersion appends v to the version history of the policy with
+// the given name. Callers are responsible for assigning v.Version
+// a value one greater than the latest stored version.
+func (s *Store) PutVersion(_ context.Context, name string, v Version) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.versions == nil {
+		s.versions = map[string][]Version{}
+	}
+	s.versions[name] = append(s.versions[name], v)
+	return nil
+}
+
+// ListVersions returns the version history of the policy with the
+// given name, ordered from oldest to newest.
+func (s *Store) ListVersions(_ context.Context, name string) ([]Version, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	versions := s.versions[name]
+	history := make([]Version, len(versions))
+	copy(history, versions)
+	return history, nil
+}
+
+// GetVersion returns a specific version of the policy with the
+// given name. It returns ErrVersionNotFound if no such version
+// exists.
+func (s *Store) GetVersion(_ context.Context, name string, version int) (Version, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	versions := s.versions[name]
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].Version >= version })
+	if i == len(versions) || versions[i].Version != version {
+		return Version{}, ErrVersionNotFound
+	}
+	return versions[i], nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2022 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package mem
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStoreVersionHistory(t *testing.T) {
+	ctx := context.Background()
+	store := &Store{}
+
+	for v := 1; v <= 3; v++ {
+		if err := store.PutVersion(ctx, "my-policy", Version{Version: v}); err != nil {
+			t.Fatalf("PutVersion(%d) failed: %v", v, err)
+		}
+	}
+
+	history, err := store.ListVersions(ctx, "my-policy")
+	if err != nil {
+		t.Fatalf("ListVersions failed: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("len(history) = %d, want 3", len(history))
+	}
+	for i, v := range history {
+		if v.Version != i+1 {
+			t.Fatalf("history[%d].Version = %d, want %d", i, v.Version, i+1)
+		}
+	}
+
+	v, err := store.GetVersion(ctx, "my-policy", 2)
+	if err != nil {
+		t.Fatalf("GetVersion(2) failed: %v", err)
+	}
+	if v.Version != 2 {
+		t.Fatalf("GetVersion(2).Version = %d, want 2", v.Version)
+	}
+
+	if _, err = store.GetVersion(ctx, "my-policy", 42); err != ErrVersionNotFound {
+		t.Fatalf("GetVersion(42) error = %v, want %v", err, ErrVersionNotFound)
+	}
+}
@@ -7,6 +7,8 @@ package mem
 
 import (
 	"context"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/minio/kes"
@@ -70,18 +72,42 @@ func (s *Store) Get(_ context.Context, name string) (key.Key, error) {
 	return k, nil
 }
 
-// List returns a new iterator over the metadata of all stored keys.
-func (s *Store) List(ctx context.Context) (key.Iterator, error) {
+// List returns a new iterator over the metadata of all stored keys
+// whose name starts with prefix.
+//
+// If continueAt is not empty, the returned iterator starts right
+// after the key with that name - allowing callers to resume a
+// previous listing. If limit is greater than zero, the iterator is
+// restricted to at most limit entries and List returns a non-empty
+// continuation token that can be passed as continueAt to fetch the
+// next page. Once the listing is exhausted the returned token is
+// empty.
+func (s *Store) List(ctx context.Context, prefix, continueAt string, limit int) (key.Iterator, string, error) {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
 	names := make([]string, 0, len(s.store))
 	for name := range s.store {
-		names = append(names, name)
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
 	}
-	return &iterator{
-		values: names,
-	}, nil
+	sort.Strings(names)
+
+	if continueAt != "" {
+		i := sort.SearchStrings(names, continueAt)
+		if i < len(names) && names[i] == continueAt {
+			i++
+		}
+		names = names[i:]
+	}
+
+	var next string
+	if limit > 0 && len(names) > limit {
+		next = names[limit-1]
+		names = names[:limit]
+	}
+	return &iterator{values: names}, next, nil
 }
 
 type iterator struct {
@@ -0,0 +1,55 @@
+// Copyright 2022 - MinIO, Inc. All rights reserved.
+// Use of this source code is governed by the AGPLv3
+// license that can be found in the LICENSE file.
+
+package mem
+
+import (
+	"context"
+	"testing"
+
+	"github.com/minio/kes/internal/key"
+)
+
+func TestStoreListPagination(t *testing.T) {
+	ctx := context.Background()
+	store := &Store{}
+
+	names := []string{"a", "ab", "abc", "b", "ba"}
+	for _, name := range names {
+		if err := store.Create(ctx, name, key.Key{}); err != nil {
+			t.Fatalf("Create(%q) failed: %v", name, err)
+		}
+	}
+
+	iterator, next, err := store.List(ctx, "a", "", 2)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var page []string
+	for iterator.Next() {
+		page = append(page, iterator.Name())
+	}
+	want := []string{"a", "ab"}
+	if len(page) != len(want) || page[0] != want[0] || page[1] != want[1] {
+		t.Fatalf("first page = %v, want %v", page, want)
+	}
+	if next != "ab" {
+		t.Fatalf("continuation token = %q, want %q", next, "ab")
+	}
+
+	iterator, next, err = store.List(ctx, "a", next, 2)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	page = nil
+	for iterator.Next() {
+		page = append(page, iterator.Name())
+	}
+	if len(page) != 1 || page[0] != "abc" {
+		t.Fatalf("second page = %v, want [abc]", page)
+	}
+	if next != "" {
+		t.Fatalf("continuation token = %q, want empty", next)
+	}
+}